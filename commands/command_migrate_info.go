@@ -1,11 +1,14 @@
 package commands
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/git-lfs/git-lfs/errors"
@@ -27,11 +30,147 @@ var (
 	// migrateInfoAbove is the number of bytes parsed from the above
 	// migrateInfoAboveFmt flag.
 	migrateInfoAbove uint64
+
+	// migrateInfoFormat is a flag given to the git-lfs-migrate(1)
+	// subcommand 'info' which selects the output format used to print the
+	// ranked entries: one of "human", "json", or "csv".
+	migrateInfoFormat string
+
+	// migrateInfoGroupBy is a flag given to the git-lfs-migrate(1)
+	// subcommand 'info' which selects how blobs are bucketed before
+	// ranking: one of "ext", "dir", or "pattern".
+	migrateInfoGroupBy string
+
+	// migrateInfoPatterns is a flag given to the git-lfs-migrate(1)
+	// subcommand 'info' specifying one or more glob patterns to match
+	// blob paths against when --group-by=pattern is given. May be
+	// repeated.
+	migrateInfoPatterns []string
+
+	// migrateInfoRebuildIndex is a flag given to the git-lfs-migrate(1)
+	// subcommand 'info' which forces the commit range to be re-walked
+	// and its cached aggregate in the migrate-index to be recomputed,
+	// rather than reused as-is.
+	migrateInfoRebuildIndex bool
+
+	// migrateInfoNoIndex is a flag given to the git-lfs-migrate(1)
+	// subcommand 'info' which disables reading from or writing to the
+	// on-disk migrate-index entirely.
+	migrateInfoNoIndex bool
+
+	// migrateInfoByDir is a flag given to the git-lfs-migrate(1)
+	// subcommand 'info' which switches to the hierarchical directory
+	// rollup mode: BytesTotal/BytesAbove are aggregated per directory
+	// prefix instead of by extension, with every directory's totals
+	// equal to those of the blobs directly in it plus the sum of its
+	// subdirectories'.
+	migrateInfoByDir bool
+
+	// migrateInfoByDirDepth is a flag given alongside --by-dir
+	// (--by-dir=<depth>) limiting how many path segments deep the
+	// rollup descends; blobs nested deeper than this are folded into
+	// the node at the depth limit. Zero means unlimited depth.
+	migrateInfoByDirDepth int
+
+	// migrateInfoSuggestAttributes is a flag given to the
+	// git-lfs-migrate(1) subcommand 'info' which, after the ranking
+	// pass, prints a `.gitattributes` fragment suggesting `filter=lfs`
+	// for the smallest set of top entries needed to reach
+	// --coverage of the total bytes above the threshold.
+	migrateInfoSuggestAttributes bool
+
+	// migrateInfoCoverage is a flag given alongside --suggest-attributes
+	// specifying the share (0, 1] of total BytesAbove that the suggested
+	// entries must collectively cover.
+	migrateInfoCoverage float64
+
+	// migrateInfoWriteAttributes is a flag given alongside
+	// --suggest-attributes specifying a `.gitattributes` file to merge
+	// the suggested lines into, rather than only printing them.
+	migrateInfoWriteAttributes string
 )
 
-func migrateInfoCommand(cmd *cobra.Command, args []string) {
-	exts := make(map[string]*MigrateInfoEntry)
+// migrateInfoFormats enumerates the valid values of the --format flag.
+var migrateInfoFormats = []string{"human", "json", "csv"}
+
+// migrateInfoGroupBys enumerates the valid values of the --group-by flag.
+var migrateInfoGroupBys = []string{"ext", "dir", "pattern"}
+
+// migrateInfoOtherQualifier is the synthetic bucket that blobs which do not
+// match any given --pattern are placed into.
+const migrateInfoOtherQualifier = "<other>"
+
+// migrateInfoEntryColumns are the stable, machine-readable column names used
+// by both the JSON and CSV output formats.
+var migrateInfoEntryColumns = []string{
+	"qualifier", "bytes_above", "bytes_total",
+	"count_above", "count_total", "percent_above", "threshold_bytes",
+}
+
+// migrateInfoBucket returns the qualifier and matcher used to group the blob
+// at "path", according to the --group-by flag given to `git lfs migrate
+// info`, and whether that matcher is a directory path rather than a glob or
+// extension (true only for --group-by=dir).
+func migrateInfoBucket(path string) (qualifier, matcher string, matcherIsDir bool) {
+	switch migrateInfoGroupBy {
+	case "dir":
+		dir := filepath.Dir(path)
+		return dir, dir, true
+	case "pattern":
+		for _, pattern := range migrateInfoPatterns {
+			if migrateInfoMatchPattern(pattern, path) {
+				return pattern, pattern, false
+			}
+		}
+		return migrateInfoOtherQualifier, "", false
+	default:
+		ext := fmt.Sprintf("*%s", filepath.Ext(path))
+		return ext, ext, false
+	}
+}
+
+// migrateInfoMatchPattern reports whether the blob path "path" matches the
+// glob "pattern", where, unlike filepath.Match, a path segment consisting
+// solely of "**" matches zero or more path segments instead of stopping at
+// the next "/". This lets patterns like "assets/**/*.psd" given to
+// --pattern match at any depth under assets/, not just one level down.
+func migrateInfoMatchPattern(pattern, path string) bool {
+	patternSegs := strings.Split(filepath.ToSlash(pattern), "/")
+	pathSegs := strings.Split(filepath.ToSlash(path), "/")
+
+	return migrateInfoMatchSegments(patternSegs, pathSegs)
+}
+
+// migrateInfoMatchSegments recursively matches "pattern" segments against
+// "path" segments, expanding "**" to match any number of path segments
+// (including none) and matching every other segment with filepath.Match.
+func migrateInfoMatchSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		if migrateInfoMatchSegments(pattern[1:], path) {
+			return true
+		}
+		if len(path) > 0 && migrateInfoMatchSegments(pattern, path[1:]) {
+			return true
+		}
+		return false
+	}
 
+	if len(path) == 0 {
+		return false
+	}
+
+	if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+		return false
+	}
+
+	return migrateInfoMatchSegments(pattern[1:], path[1:])
+}
+
+func migrateInfoCommand(cmd *cobra.Command, args []string) {
 	above, err := humanize.ParseBytes(migrateInfoAboveFmt)
 	if err != nil {
 		ExitWithError(errors.Wrap(err, "cannot parse --above=<n>"))
@@ -39,44 +178,248 @@ func migrateInfoCommand(cmd *cobra.Command, args []string) {
 
 	migrateInfoAbove = above
 
-	migrate(cmd, args, func(path string, b *odb.Blob) (*odb.Blob, error) {
-		ext := fmt.Sprintf("*%s", filepath.Ext(path))
+	validFormat := false
+	for _, format := range migrateInfoFormats {
+		if migrateInfoFormat == format {
+			validFormat = true
+			break
+		}
+	}
+	if !validFormat {
+		ExitWithError(errors.Errorf("git lfs migrate info: unsupported --format=%q, expected one of: %s",
+			migrateInfoFormat, strings.Join(migrateInfoFormats, ", ")))
+	}
+
+	if migrateInfoByDir {
+		migrateInfoByDirCommand(cmd, args)
+		return
+	}
+
+	validGroupBy := false
+	for _, groupBy := range migrateInfoGroupBys {
+		if migrateInfoGroupBy == groupBy {
+			validGroupBy = true
+			break
+		}
+	}
+	if !validGroupBy {
+		ExitWithError(errors.Errorf("git lfs migrate info: unsupported --group-by=%q, expected one of: %s",
+			migrateInfoGroupBy, strings.Join(migrateInfoGroupBys, ", ")))
+	}
+	if migrateInfoGroupBy == "pattern" && len(migrateInfoPatterns) == 0 {
+		ExitWithError(errors.Errorf("git lfs migrate info: --group-by=pattern requires at least one --pattern=<glob>"))
+	}
+
+	if migrateInfoNoIndex {
+		exts, _ := migrateInfoWalk(cmd, args, nil)
+		entries := EntriesBySize(MapToEntries(exts))
+		migrateInfoFinish(entries, entries.summarize())
+		return
+	}
+
+	idx, err := loadMigrateIndex()
+	if err != nil {
+		ExitWithError(errors.Wrap(err, "cannot load migrate-index"))
+	}
+
+	target, eligible, err := migrateIndexResolveTarget(args)
+	if err != nil {
+		ExitWithError(errors.Wrap(err, "cannot resolve migrate-index target"))
+	}
 
-		if len(ext) > 1 {
-			entry := exts[ext]
-			if entry == nil {
-				entry = &MigrateInfoEntry{Qualifier: ext}
+	var lineageKey string
+	if eligible {
+		lineageKey = migrateIndexLineageKey(target.Identity)
+	}
+
+	if eligible && !migrateInfoRebuildIndex {
+		if state, ok := idx.ranges[lineageKey]; ok {
+			if state.Sha == target.Sha {
+				// Exact hit: nothing has moved since this lineage
+				// was last indexed.
+				entries := EntriesBySize(state.Entries)
+				migrateInfoFinish(entries, entries.summarize())
+				return
 			}
 
-			entry.Total++
-			entry.BytesTotal += b.Size
+			ancestor, err := migrateIndexIsAncestor(state.Sha, target.Sha)
+			if err != nil {
+				ExitWithError(errors.Wrap(err, "cannot check migrate-index ancestry"))
+			}
 
-			if b.Size > int64(migrateInfoAbove) {
-				entry.TotalAbove++
-				entry.BytesAbove += b.Size
+			if ancestor {
+				// The target has fast-forwarded: walk only the
+				// commits appended since the cached Sha, and
+				// merge that delta into the cached aggregate
+				// instead of recomputing it from scratch. "state.Oids"
+				// is passed as the skip set so that a blob already
+				// counted in the cached aggregate -- including one
+				// reintroduced unchanged by a branch merged in since
+				// the cache was last updated -- is not counted again
+				// just because it is newly reachable from the delta
+				// range too.
+				deltaArgs := []string{fmt.Sprintf("%s..%s", state.Sha, target.Sha)}
+				delta, deltaOids := migrateInfoWalk(cmd, deltaArgs, state.Oids)
+				merged := mergeMigrateInfoEntries(state.Entries, MapToEntries(delta))
+				oids := migrateIndexUnionOids(state.Oids, deltaOids)
+
+				idx.RecordRange(lineageKey, target.Sha, merged, oids)
+				if err := idx.Save(); err != nil {
+					ExitWithError(errors.Wrap(err, "cannot save migrate-index"))
+				}
+
+				entries := EntriesBySize(merged)
+				migrateInfoFinish(entries, entries.summarize())
+				return
 			}
 
-			exts[ext] = entry
+			// state.Sha is no longer an ancestor of target.Sha: the
+			// ref was rebased, reset, or otherwise rewritten since
+			// it was last indexed, so the cached aggregate may
+			// describe history the target no longer contains. Fall
+			// through and rebuild from scratch rather than merge a
+			// delta that no longer means what it used to.
 		}
+	}
+
+	exts, oids := migrateInfoWalk(cmd, args, nil)
+	entries := MapToEntries(exts)
+
+	if eligible {
+		idx.RecordRange(lineageKey, target.Sha, entries, oids)
+		if err := idx.Save(); err != nil {
+			ExitWithError(errors.Wrap(err, "cannot save migrate-index"))
+		}
+	}
+
+	result := EntriesBySize(entries)
+	migrateInfoFinish(result, result.summarize())
+}
+
+// migrateInfoWalk walks the commit range named by "args", bucketing blobs
+// according to --group-by (and --pattern, --above), and returns the
+// resulting entries keyed by qualifier, along with the set of blob OIDs that
+// contributed to them.
+//
+// "skip" names blob OIDs already counted by some earlier walk over this
+// lineage -- the migrate-index's cached aggregate -- and must not be counted
+// again here. Without it, a blob reachable from more than one commit range
+// (for example one removed and then reintroduced with identical content on
+// a branch merged in after the cache was last updated) would have its bytes
+// counted once in the cached aggregate and again in the delta, doubling it
+// once the two are merged. "skip" may be nil, which is correct for a full,
+// uncached walk, where every blob is new by definition.
+//
+// "skip" is the only source of cross-call dedup: within a single walk, every
+// path is counted into its own bucket even if it shares an OID with another
+// path already seen here. Buckets are defined by path, not content --
+// --group-by=dir and --by-dir key directly on the directory, and two
+// distinct files of the same extension are still two distinct files -- so
+// deduping by OID within one walk would silently undercount every bucket
+// but the first one a duplicated blob happened to land in.
+func migrateInfoWalk(cmd *cobra.Command, args []string, skip map[string]bool) (map[string]*MigrateInfoEntry, map[string]bool) {
+	exts := make(map[string]*MigrateInfoEntry)
+	counted := make(map[string]bool)
 
+	migrate(cmd, args, func(path string, b *odb.Blob) (*odb.Blob, error) {
+		counted[b.Oid] = true
+		migrateInfoAccumulateBlob(exts, skip, path, b.Oid, b.Size)
 		return b, nil
 	})
 
-	entries := EntriesBySize(MapToEntries(exts))
+	return exts, counted
+}
+
+// migrateInfoAccumulateBlob is the per-blob body of migrateInfoWalk's
+// migrate() callback, split out so the bucketing and accumulation logic can
+// be driven directly by tests without a repository to walk. It buckets the
+// blob at "path" (with the given "oid" and "size") into "exts", unless
+// "oid" is in "skip".
+func migrateInfoAccumulateBlob(exts map[string]*MigrateInfoEntry, skip map[string]bool, path, oid string, size int64) {
+	if skip[oid] {
+		return
+	}
+
+	qualifier, matcher, matcherIsDir := migrateInfoBucket(path)
+
+	if migrateInfoGroupBy == "ext" && len(qualifier) <= 1 {
+		return
+	}
+
+	entry := exts[qualifier]
+	if entry == nil {
+		entry = &MigrateInfoEntry{Qualifier: qualifier, Matcher: matcher, MatcherIsDir: matcherIsDir}
+	}
+
+	entry.Total++
+	entry.BytesTotal += size
+
+	if size > int64(migrateInfoAbove) {
+		entry.TotalAbove++
+		entry.BytesAbove += size
+	}
+
+	exts[qualifier] = entry
+}
+
+// migrateInfoFinish sorts "entries", emits any --suggest-attributes output
+// over the full set, then clamps to --top and prints in the selected
+// --format. It is the common tail shared by every path through
+// migrateInfoCommand, cached or freshly walked. "summary" must describe
+// "entries" in full, before any --top clamping; callers whose entries aren't
+// disjoint (such as the --by-dir trie, where every node's totals include its
+// descendants') must pass a summary computed some other way than summing
+// entries, since summing them would count each blob once per ancestor
+// directory.
+func migrateInfoFinish(entries EntriesBySize, summary migrateInfoSummary) {
 	sort.Sort(sort.Reverse(entries))
 
-	migrateInfoTopN = tools.ClampInt(migrateInfoTopN, len(entries), 0)
+	migrateInfoMaybeSuggestAttributes(entries)
+
+	migrateInfoPrintEntries(entries, summary)
+}
 
-	entries = entries[:tools.MaxInt(0, migrateInfoTopN)]
+// migrateInfoPrintEntries prints "entries" in the format selected by the
+// --format flag, applying the same top-N clamp used by a freshly computed
+// result so that a migrate-index cache hit is indistinguishable from a cache
+// miss to the caller.
+func migrateInfoPrintEntries(entries EntriesBySize, summary migrateInfoSummary) {
+	sort.Sort(sort.Reverse(entries))
 
-	entries.Print(os.Stderr)
+	topN := tools.ClampInt(migrateInfoTopN, len(entries), 0)
+	entries = entries[:tools.MaxInt(0, topN)]
+
+	var err error
+	switch migrateInfoFormat {
+	case "json":
+		_, err = entries.PrintJSON(os.Stdout, summary)
+	case "csv":
+		_, err = entries.PrintCSV(os.Stdout)
+	default:
+		_, err = entries.Print(os.Stderr)
+	}
+	if err != nil {
+		ExitWithError(errors.Wrap(err, "cannot print migrate info"))
+	}
 }
 
 // MigrateInfoEntry represents a tuple of filetype to total size taken by that
 // file type.
 type MigrateInfoEntry struct {
-	// Qualifier is the filepath's extension.
+	// Qualifier is the filepath's extension, directory, or matching
+	// --pattern, depending on --group-by.
 	Qualifier string
+	// Matcher is the glob pattern or directory path that blobs were
+	// matched against to land in this entry's bucket, preserved so that
+	// a later `.gitattributes` suggestion can reuse it. It is empty for
+	// the synthetic "<other>" bucket.
+	Matcher string
+	// MatcherIsDir reports whether Matcher is a directory path rather
+	// than a glob or extension pattern, i.e. produced by --group-by=dir
+	// or --by-dir. A bare directory path in `.gitattributes` does not
+	// match files underneath it the way a glob does, so a
+	// --suggest-attributes line built from it needs a `/**` suffix.
+	MatcherIsDir bool
 
 	BytesAbove int64
 	TotalAbove int64
@@ -134,7 +477,7 @@ func (e EntriesBySize) Print(to io.Writer) (int, error) {
 
 	percentages := make([]string, 0, len(e))
 	for _, entry := range e {
-		percentAbove := 100 * (float64(entry.TotalAbove) / float64(entry.Total))
+		percentAbove := migrateInfoPercentAbove(entry.TotalAbove, entry.Total)
 
 		percentage := fmt.Sprintf("%.0f%%", percentAbove)
 
@@ -157,4 +500,141 @@ func (e EntriesBySize) Print(to io.Writer) (int, error) {
 	output = append([]string{header}, output...)
 
 	return fmt.Fprintln(to, strings.Join(output, "\n"))
-}
\ No newline at end of file
+}
+
+// migrateInfoRow is the machine-readable representation of a single
+// `*MigrateInfoEntry`, used by both the JSON and CSV output formats.
+type migrateInfoRow struct {
+	Qualifier      string  `json:"qualifier"`
+	BytesAbove     int64   `json:"bytes_above"`
+	BytesTotal     int64   `json:"bytes_total"`
+	CountAbove     int64   `json:"count_above"`
+	CountTotal     int64   `json:"count_total"`
+	PercentAbove   float64 `json:"percent_above"`
+	ThresholdBytes uint64  `json:"threshold_bytes"`
+}
+
+// migrateInfoSummary is the top-level object accompanying the ranked entries
+// in JSON output, giving totals across all buckets regardless of --top.
+type migrateInfoSummary struct {
+	BytesAbove     int64  `json:"bytes_above"`
+	BytesTotal     int64  `json:"bytes_total"`
+	CountAbove     int64  `json:"count_above"`
+	CountTotal     int64  `json:"count_total"`
+	ThresholdBytes uint64 `json:"threshold_bytes"`
+}
+
+// migrateInfoPercentAbove returns the percentage of "total" represented by
+// "above", or zero if "total" is zero (such as an empty --by-dir trie node)
+// rather than NaN, which json.Marshal refuses to encode.
+func migrateInfoPercentAbove(above, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * (float64(above) / float64(total))
+}
+
+// rows converts the set of `*MigrateInfoEntry`'s into their machine-readable
+// representation, shared by the JSON and CSV writers.
+func (e EntriesBySize) rows() []migrateInfoRow {
+	rows := make([]migrateInfoRow, 0, len(e))
+	for _, entry := range e {
+		percentAbove := migrateInfoPercentAbove(entry.TotalAbove, entry.Total)
+
+		rows = append(rows, migrateInfoRow{
+			Qualifier:      entry.Qualifier,
+			BytesAbove:     entry.BytesAbove,
+			BytesTotal:     entry.BytesTotal,
+			CountAbove:     entry.TotalAbove,
+			CountTotal:     entry.Total,
+			PercentAbove:   percentAbove,
+			ThresholdBytes: migrateInfoAbove,
+		})
+	}
+	return rows
+}
+
+// summarize returns the totals across every entry in the set, regardless of
+// any --top clamp applied afterward. Callers must compute this before
+// truncating "e" to --top entries.
+func (e EntriesBySize) summarize() migrateInfoSummary {
+	summary := migrateInfoSummary{ThresholdBytes: migrateInfoAbove}
+	for _, entry := range e {
+		summary.BytesAbove += entry.BytesAbove
+		summary.BytesTotal += entry.BytesTotal
+		summary.CountAbove += entry.TotalAbove
+		summary.CountTotal += entry.Total
+	}
+	return summary
+}
+
+// migrateInfoSummaryFromEntry returns the migrateInfoSummary describing a
+// single entry's totals directly, rather than by summing a set of entries.
+// This is for callers such as --by-dir, whose flattened trie entries are not
+// disjoint (every node's totals already include its descendants'), so
+// summarize() over all of them would count each blob once per ancestor
+// directory; the trie root's own entry already holds the true totals.
+func migrateInfoSummaryFromEntry(entry *MigrateInfoEntry) migrateInfoSummary {
+	return migrateInfoSummary{
+		BytesAbove:     entry.BytesAbove,
+		BytesTotal:     entry.BytesTotal,
+		CountAbove:     entry.TotalAbove,
+		CountTotal:     entry.Total,
+		ThresholdBytes: migrateInfoAbove,
+	}
+}
+
+// PrintJSON marshals the `*MigrateInfoEntry`'s in the set as a JSON object
+// with a top-level "entries" array and "summary" totals, and writes it to the
+// given io.Writer, "to". "summary" should be computed from the full,
+// unclamped entry set, since --top only limits how many rows are listed, not
+// what the totals describe.
+func (e EntriesBySize) PrintJSON(to io.Writer, summary migrateInfoSummary) (int, error) {
+	payload := struct {
+		Entries []migrateInfoRow   `json:"entries"`
+		Summary migrateInfoSummary `json:"summary"`
+	}{
+		Entries: e.rows(),
+		Summary: summary,
+	}
+
+	out, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return 0, errors.Wrap(err, "cannot marshal migrate info as JSON")
+	}
+
+	return fmt.Fprintln(to, string(out))
+}
+
+// PrintCSV writes the `*MigrateInfoEntry`'s in the set as CSV, with a header
+// row matching migrateInfoEntryColumns, to the given io.Writer, "to".
+func (e EntriesBySize) PrintCSV(to io.Writer) (int, error) {
+	w := csv.NewWriter(to)
+
+	if err := w.Write(migrateInfoEntryColumns); err != nil {
+		return 0, errors.Wrap(err, "cannot write migrate info CSV header")
+	}
+
+	for _, row := range e.rows() {
+		record := []string{
+			row.Qualifier,
+			strconv.FormatInt(row.BytesAbove, 10),
+			strconv.FormatInt(row.BytesTotal, 10),
+			strconv.FormatInt(row.CountAbove, 10),
+			strconv.FormatInt(row.CountTotal, 10),
+			strconv.FormatFloat(row.PercentAbove, 'f', 2, 64),
+			strconv.FormatUint(row.ThresholdBytes, 10),
+		}
+
+		if err := w.Write(record); err != nil {
+			return 0, errors.Wrap(err, "cannot write migrate info CSV row")
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return 0, errors.Wrap(err, "cannot flush migrate info CSV output")
+	}
+
+	return 0, nil
+}
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/errors"
+)
+
+// migrateInfoAttributeLine formats the `.gitattributes` line suggesting
+// `filter=lfs` for the given pattern. A bare directory path does not match
+// the files beneath it the way a `.gitattributes` glob does, so when
+// "isDir" is set -- meaning "pattern" came from --group-by=dir or --by-dir,
+// not a glob or extension -- a `/**` suffix is appended so the suggestion
+// actually covers the directory's contents.
+func migrateInfoAttributeLine(pattern string, isDir bool) string {
+	if isDir {
+		if pattern == migrateDirRoot {
+			pattern = "**"
+		} else {
+			pattern = filepath.ToSlash(pattern) + "/**"
+		}
+	}
+	return fmt.Sprintf("%s filter=lfs diff=lfs merge=lfs -text", pattern)
+}
+
+// migrateInfoSuggestedAttributeLines returns the `.gitattributes` lines
+// needed to cover at least migrateInfoCoverage of the total BytesAbove found
+// across "entries" (which must already be sorted by descending BytesAbove),
+// using each entry's Matcher as the attribute pattern. Entries with an empty
+// Matcher, such as the synthetic "<other>" bucket, are skipped, since they do
+// not correspond to a single `.gitattributes` pattern.
+func migrateInfoSuggestedAttributeLines(entries EntriesBySize) []string {
+	var total int64
+	for _, entry := range entries {
+		total += entry.BytesAbove
+	}
+
+	if total == 0 {
+		return nil
+	}
+
+	threshold := migrateInfoCoverage * float64(total)
+
+	var lines []string
+	var cumulative int64
+	for _, entry := range entries {
+		if len(entry.Matcher) == 0 {
+			continue
+		}
+
+		lines = append(lines, migrateInfoAttributeLine(entry.Matcher, entry.MatcherIsDir))
+		cumulative += entry.BytesAbove
+
+		if float64(cumulative) >= threshold {
+			break
+		}
+	}
+
+	return lines
+}
+
+// migrateInfoMergeAttributesFile merges "lines" into the file at "path",
+// appending only those not already present so that re-running
+// --write-attributes is idempotent. The file is created if it does not yet
+// exist.
+func migrateInfoMergeAttributesFile(path string, lines []string) error {
+	existing := make(map[string]bool)
+
+	var content []string
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return errors.Wrap(err, "cannot read --write-attributes file")
+		}
+	} else {
+		content = strings.Split(string(data), "\n")
+
+		// strings.Split on a file ending in "\n" (as every file this
+		// function writes does) produces one trailing empty element;
+		// drop only that one so re-merging stays idempotent, rather
+		// than every blank line, which a hand-maintained
+		// .gitattributes can legitimately use to group rules.
+		if len(content) > 0 && content[len(content)-1] == "" {
+			content = content[:len(content)-1]
+		}
+
+		for _, line := range content {
+			existing[line] = true
+		}
+	}
+
+	changed := false
+	for _, line := range lines {
+		if existing[line] {
+			continue
+		}
+
+		content = append(content, line)
+		existing[line] = true
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+
+	return ioutil.WriteFile(path, []byte(strings.Join(content, "\n")+"\n"), 0644)
+}
+
+// migrateInfoMaybeSuggestAttributes prints a `.gitattributes` fragment
+// covering --coverage of the total BytesAbove in "entries", and merges it
+// into --write-attributes if given, when --suggest-attributes was passed. It
+// is a no-op otherwise. "entries" must already be sorted by descending
+// BytesAbove and must not yet be clamped to --top, since the coverage
+// calculation considers every ranked entry.
+//
+// The fragment is written to stdout only when --format=human, matching the
+// "pipeable suggestion, human report on stderr" design of the default
+// output. For --format=json or --format=csv, stdout is already reserved for
+// the machine-readable ranking, so the fragment goes to stderr instead to
+// avoid interleaving two formats on one stream.
+func migrateInfoMaybeSuggestAttributes(entries EntriesBySize) {
+	if !migrateInfoSuggestAttributes {
+		return
+	}
+
+	if migrateInfoCoverage <= 0 || migrateInfoCoverage > 1 {
+		ExitWithError(errors.Errorf("git lfs migrate info: --coverage=%v must be in the range (0, 1]", migrateInfoCoverage))
+	}
+
+	lines := migrateInfoSuggestedAttributeLines(entries)
+
+	to := os.Stdout
+	if migrateInfoFormat != "human" {
+		to = os.Stderr
+	}
+	for _, line := range lines {
+		fmt.Fprintln(to, line)
+	}
+
+	if len(migrateInfoWriteAttributes) > 0 {
+		if err := migrateInfoMergeAttributesFile(migrateInfoWriteAttributes, lines); err != nil {
+			ExitWithError(errors.Wrap(err, "cannot write --write-attributes file"))
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateInfoAttributeLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		isDir   bool
+		want    string
+	}{
+		{"glob pattern is used verbatim", "*.psd", false, "*.psd filter=lfs diff=lfs merge=lfs -text"},
+		{"directory pattern gets a /** suffix", "assets", true, "assets/** filter=lfs diff=lfs merge=lfs -text"},
+		{"repo root directory becomes **", migrateDirRoot, true, "** filter=lfs diff=lfs merge=lfs -text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := migrateInfoAttributeLine(tt.pattern, tt.isDir)
+			if got != tt.want {
+				t.Errorf("migrateInfoAttributeLine(%q, %v) = %q, want %q", tt.pattern, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestMigrateInfoSuggestedAttributeLines covers the cumulative-coverage
+// loop: entries are consumed, in order, until the running total of
+// BytesAbove meets --coverage of the overall total.
+func TestMigrateInfoSuggestedAttributeLines(t *testing.T) {
+	entries := EntriesBySize{
+		{Qualifier: "*.psd", Matcher: "*.psd", BytesAbove: 70},
+		{Qualifier: "*.zip", Matcher: "*.zip", BytesAbove: 20},
+		{Qualifier: "*.png", Matcher: "*.png", BytesAbove: 10},
+	}
+
+	migrateInfoCoverage = 0.9
+	lines := migrateInfoSuggestedAttributeLines(entries)
+
+	want := []string{
+		migrateInfoAttributeLine("*.psd", false),
+		migrateInfoAttributeLine("*.zip", false),
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines to reach 90%% coverage, got %d: %v", len(want), len(lines), lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("line %d = %q, want %q", i, lines[i], want[i])
+		}
+	}
+}
+
+// TestMigrateInfoSuggestedAttributeLinesSkipsOther covers that the
+// synthetic "<other>" bucket, which has no Matcher, never contributes a
+// line even if it would otherwise be needed to reach --coverage.
+func TestMigrateInfoSuggestedAttributeLinesSkipsOther(t *testing.T) {
+	entries := EntriesBySize{
+		{Qualifier: "*.psd", Matcher: "*.psd", BytesAbove: 10},
+		{Qualifier: migrateInfoOtherQualifier, Matcher: "", BytesAbove: 90},
+	}
+
+	migrateInfoCoverage = 0.95
+	lines := migrateInfoSuggestedAttributeLines(entries)
+
+	if len(lines) != 1 || lines[0] != migrateInfoAttributeLine("*.psd", false) {
+		t.Errorf("expected only the *.psd line, got %v", lines)
+	}
+}
+
+// TestMigrateInfoSuggestedAttributeLinesUsesDirSuffix covers that a
+// --group-by=dir or --by-dir entry's matcher is suffixed with /** rather
+// than suggested verbatim.
+func TestMigrateInfoSuggestedAttributeLinesUsesDirSuffix(t *testing.T) {
+	entries := EntriesBySize{
+		{Qualifier: "assets", Matcher: "assets", MatcherIsDir: true, BytesAbove: 100},
+	}
+
+	migrateInfoCoverage = 0.9
+	lines := migrateInfoSuggestedAttributeLines(entries)
+
+	want := "assets/** filter=lfs diff=lfs merge=lfs -text"
+	if len(lines) != 1 || lines[0] != want {
+		t.Errorf("expected %q, got %v", want, lines)
+	}
+}
+
+// TestMigrateInfoMergeAttributesFile covers that merging is idempotent: a
+// line already present is neither duplicated nor reordered, and the file is
+// untouched (no write, no error) if nothing new needs adding.
+func TestMigrateInfoMergeAttributesFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate-info-attributes-test")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".gitattributes")
+	if err := ioutil.WriteFile(path, []byte("*.psd filter=lfs diff=lfs merge=lfs -text\n"), 0644); err != nil {
+		t.Fatalf("unexpected error seeding file: %v", err)
+	}
+
+	if err := migrateInfoMergeAttributesFile(path, []string{
+		"*.psd filter=lfs diff=lfs merge=lfs -text",
+		"*.zip filter=lfs diff=lfs merge=lfs -text",
+	}); err != nil {
+		t.Fatalf("unexpected error merging attributes: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error reading merged file: %v", err)
+	}
+
+	want := "*.psd filter=lfs diff=lfs merge=lfs -text\n*.zip filter=lfs diff=lfs merge=lfs -text\n"
+	if string(data) != want {
+		t.Fatalf("merged file = %q, want %q", string(data), want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("unexpected error statting file: %v", err)
+	}
+	modTime := info.ModTime()
+
+	if err := migrateInfoMergeAttributesFile(path, []string{"*.psd filter=lfs diff=lfs merge=lfs -text"}); err != nil {
+		t.Fatalf("unexpected error re-merging already-present lines: %v", err)
+	}
+
+	data, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error re-reading file: %v", err)
+	}
+	if string(data) != want {
+		t.Errorf("re-merging an already-present line changed the file: got %q, want %q", string(data), want)
+	}
+
+	info, err = os.Stat(path)
+	if err != nil {
+		t.Fatalf("unexpected error statting file: %v", err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Errorf("expected a no-op merge not to rewrite the file")
+	}
+}
+
+// TestMigrateInfoMergeAttributesFilePreservesBlankLines covers that a blank
+// separator line in a hand-maintained .gitattributes survives a merge: the
+// tool only owns the lines it adds, not the rest of the file's formatting.
+func TestMigrateInfoMergeAttributesFilePreservesBlankLines(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate-info-attributes-test")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".gitattributes")
+	seed := "# images\n*.psd filter=lfs diff=lfs merge=lfs -text\n\n# archives\n*.zip filter=lfs diff=lfs merge=lfs -text\n"
+	if err := ioutil.WriteFile(path, []byte(seed), 0644); err != nil {
+		t.Fatalf("unexpected error seeding file: %v", err)
+	}
+
+	if err := migrateInfoMergeAttributesFile(path, []string{"*.png filter=lfs diff=lfs merge=lfs -text"}); err != nil {
+		t.Fatalf("unexpected error merging attributes: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error reading merged file: %v", err)
+	}
+
+	want := seed + "*.png filter=lfs diff=lfs merge=lfs -text\n"
+	if string(data) != want {
+		t.Fatalf("merged file = %q, want %q", string(data), want)
+	}
+}
+
+// TestMigrateInfoMergeAttributesFileCreatesMissing covers that merging into
+// a path that does not yet exist creates it instead of erroring.
+func TestMigrateInfoMergeAttributesFileCreatesMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate-info-attributes-test")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".gitattributes")
+	if err := migrateInfoMergeAttributesFile(path, []string{"*.psd filter=lfs diff=lfs merge=lfs -text"}); err != nil {
+		t.Fatalf("unexpected error merging into a missing file: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error reading created file: %v", err)
+	}
+	if string(data) != "*.psd filter=lfs diff=lfs merge=lfs -text\n" {
+		t.Errorf("unexpected created file contents: %q", string(data))
+	}
+}
@@ -0,0 +1,122 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/git-lfs/git-lfs/git/odb"
+	"github.com/spf13/cobra"
+)
+
+// migrateInfoByDirCommand implements `git lfs migrate info --by-dir`,
+// rolling up BytesTotal/BytesAbove per directory prefix instead of bucketing
+// by extension, directory, or pattern as migrateInfoCommand does by default.
+//
+// The migrate-index is not consulted in this mode; the directory trie is
+// rebuilt from a full walk every time --by-dir is given. It still goes
+// through migrateInfoFinish like every other grouping mode, so
+// --suggest-attributes behaves the same way here as it does elsewhere
+// instead of being silently skipped.
+func migrateInfoByDirCommand(cmd *cobra.Command, args []string) {
+	root := newMigrateDirNode(migrateDirRoot)
+
+	migrate(cmd, args, func(path string, b *odb.Blob) (*odb.Blob, error) {
+		segments := migrateDirSegments(path, migrateInfoByDirDepth)
+		above := b.Size > int64(migrateInfoAbove)
+
+		root.insert(segments, b.Size, above)
+
+		return b, nil
+	})
+
+	var flattened []*MigrateInfoEntry
+	root.flatten(&flattened)
+
+	entries := EntriesBySize(flattened)
+
+	// root.entry alone already totals every blob in the tree; every other
+	// node's totals are included in it too, so summing the whole flattened
+	// slice (as EntriesBySize.summarize does) would count each blob once
+	// per ancestor directory instead of once.
+	migrateInfoFinish(entries, migrateInfoSummaryFromEntry(root.entry))
+}
+
+// migrateDirNode is a single node of the directory trie built by --by-dir,
+// accumulating the totals for every blob found at or below its path.
+type migrateDirNode struct {
+	path     string
+	children map[string]*migrateDirNode
+	entry    *MigrateInfoEntry
+}
+
+// migrateDirRoot is the qualifier given to the trie's root node, representing
+// the repository root directory.
+const migrateDirRoot = "."
+
+// newMigrateDirNode returns a *migrateDirNode rooted at "path", with an
+// empty accumulator entry.
+func newMigrateDirNode(path string) *migrateDirNode {
+	return &migrateDirNode{
+		path:     path,
+		children: make(map[string]*migrateDirNode),
+		entry:    &MigrateInfoEntry{Qualifier: path, Matcher: path, MatcherIsDir: true},
+	}
+}
+
+// migrateDirSegments splits a blob's path into the directory segments
+// leading up to it, ignoring the filename itself. If "depth" is greater than
+// zero, the segments are truncated to that many levels, so that blobs deeper
+// than "depth" are rolled up into the node at the depth limit.
+func migrateDirSegments(path string, depth int) []string {
+	dir := filepath.ToSlash(filepath.Dir(path))
+	if dir == "." || dir == "" {
+		return nil
+	}
+
+	segments := strings.Split(dir, "/")
+	if depth > 0 && len(segments) > depth {
+		segments = segments[:depth]
+	}
+
+	return segments
+}
+
+// insert accumulates a blob of the given size into "n" and every one of its
+// descendant nodes named by "segments", creating new nodes as needed. Each
+// node's totals are therefore always equal to those of the blobs directly in
+// it plus the sum of its children's, since every blob below it passes through
+// it on the way down.
+func (n *migrateDirNode) insert(segments []string, size int64, above bool) {
+	n.entry.Total++
+	n.entry.BytesTotal += size
+	if above {
+		n.entry.TotalAbove++
+		n.entry.BytesAbove += size
+	}
+
+	if len(segments) == 0 {
+		return
+	}
+
+	head := segments[0]
+	child, ok := n.children[head]
+	if !ok {
+		childPath := head
+		if n.path != migrateDirRoot {
+			childPath = filepath.Join(n.path, head)
+		}
+		child = newMigrateDirNode(childPath)
+		n.children[head] = child
+	}
+
+	child.insert(segments[1:], size, above)
+}
+
+// flatten appends the entry for "n" and every one of its descendants, in no
+// particular order, to "out".
+func (n *migrateDirNode) flatten(out *[]*MigrateInfoEntry) {
+	*out = append(*out, n.entry)
+	for _, child := range n.children {
+		child.flatten(out)
+	}
+}
@@ -0,0 +1,101 @@
+package commands
+
+import "testing"
+
+func TestMigrateDirSegments(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		depth int
+		want  []string
+	}{
+		{"root-level file has no segments", "LICENSE", 0, nil},
+		{"nested file", "assets/textures/foo.psd", 0, []string{"assets", "textures"}},
+		{"depth limits segments", "assets/textures/sub/foo.psd", 2, []string{"assets", "textures"}},
+		{"depth above actual nesting is a no-op", "assets/foo.psd", 5, []string{"assets"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := migrateDirSegments(tt.path, tt.depth)
+			if len(got) != len(tt.want) {
+				t.Fatalf("migrateDirSegments(%q, %d) = %v, want %v", tt.path, tt.depth, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("migrateDirSegments(%q, %d)[%d] = %q, want %q", tt.path, tt.depth, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestMigrateDirNodeInsertRollsUpTotals covers the trie's core invariant:
+// every node's totals equal those of the blobs directly in it plus the sum of
+// its children's, since every blob passes through its ancestors on the way
+// down.
+func TestMigrateDirNodeInsertRollsUpTotals(t *testing.T) {
+	root := newMigrateDirNode(migrateDirRoot)
+
+	root.insert(migrateDirSegments("assets/textures/foo.psd", 0), 100, true)
+	root.insert(migrateDirSegments("assets/textures/bar.psd", 0), 50, false)
+	root.insert(migrateDirSegments("assets/audio/clip.wav", 0), 10, false)
+	root.insert(migrateDirSegments("README.md", 0), 1, false)
+
+	if root.entry.Total != 4 || root.entry.BytesTotal != 161 {
+		t.Fatalf("expected root to total every blob, got %+v", root.entry)
+	}
+	if root.entry.TotalAbove != 1 || root.entry.BytesAbove != 100 {
+		t.Errorf("expected root's above-threshold totals to include the one blob above, got %+v", root.entry)
+	}
+
+	assets, ok := root.children["assets"]
+	if !ok {
+		t.Fatalf("expected a child node for %q", "assets")
+	}
+	if assets.entry.Total != 3 || assets.entry.BytesTotal != 160 {
+		t.Errorf("expected assets/ to total its three descendants, got %+v", assets.entry)
+	}
+	if assets.path != "assets" {
+		t.Errorf("expected assets node path to be %q, got %q", "assets", assets.path)
+	}
+
+	textures, ok := assets.children["textures"]
+	if !ok {
+		t.Fatalf("expected a child node for %q", "textures")
+	}
+	if textures.entry.Total != 2 || textures.entry.BytesTotal != 150 {
+		t.Errorf("expected assets/textures to total its two blobs, got %+v", textures.entry)
+	}
+	if textures.path != "assets/textures" {
+		t.Errorf("expected nested node path to be joined, got %q", textures.path)
+	}
+	if !textures.entry.MatcherIsDir {
+		t.Errorf("expected a --by-dir node's entry to have MatcherIsDir set")
+	}
+}
+
+// TestMigrateDirNodeFlatten covers that every node in the trie -- root and
+// every descendant -- appears exactly once in the flattened output.
+func TestMigrateDirNodeFlatten(t *testing.T) {
+	root := newMigrateDirNode(migrateDirRoot)
+	root.insert(migrateDirSegments("assets/textures/foo.psd", 0), 100, false)
+	root.insert(migrateDirSegments("bin/tool", 0), 10, false)
+
+	var flattened []*MigrateInfoEntry
+	root.flatten(&flattened)
+
+	want := map[string]bool{".": true, "assets": true, "assets/textures": true, "bin": true}
+	if len(flattened) != len(want) {
+		t.Fatalf("expected %d flattened entries, got %d: %+v", len(want), len(flattened), flattened)
+	}
+	for _, entry := range flattened {
+		if !want[entry.Qualifier] {
+			t.Errorf("unexpected entry in flattened output: %+v", entry)
+		}
+		delete(want, entry.Qualifier)
+	}
+	if len(want) != 0 {
+		t.Errorf("missing expected entries in flattened output: %+v", want)
+	}
+}
@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeMigrateInfoEntries(t *testing.T) {
+	base := []*MigrateInfoEntry{
+		{Qualifier: "*.psd", Matcher: "*.psd", BytesAbove: 10, TotalAbove: 1, BytesTotal: 20, Total: 2},
+		{Qualifier: "*.zip", Matcher: "*.zip", BytesAbove: 5, TotalAbove: 1, BytesTotal: 5, Total: 1},
+	}
+	delta := []*MigrateInfoEntry{
+		{Qualifier: "*.psd", Matcher: "*.psd", BytesAbove: 1, TotalAbove: 1, BytesTotal: 1, Total: 1},
+		{Qualifier: "*.png", Matcher: "*.png", BytesAbove: 3, TotalAbove: 1, BytesTotal: 3, Total: 1},
+	}
+
+	merged := mergeMigrateInfoEntries(base, delta)
+
+	byQualifier := make(map[string]*MigrateInfoEntry, len(merged))
+	for _, entry := range merged {
+		byQualifier[entry.Qualifier] = entry
+	}
+
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 merged entries, got %d", len(merged))
+	}
+
+	psd, ok := byQualifier["*.psd"]
+	if !ok {
+		t.Fatalf("expected a merged entry for %q", "*.psd")
+	}
+	if psd.BytesAbove != 11 || psd.TotalAbove != 2 || psd.BytesTotal != 21 || psd.Total != 3 {
+		t.Errorf("unexpected merged totals for %q: %+v", "*.psd", psd)
+	}
+
+	zip, ok := byQualifier["*.zip"]
+	if !ok || zip.BytesAbove != 5 || zip.Total != 1 {
+		t.Errorf("expected %q to be carried over from base unchanged, got %+v", "*.zip", zip)
+	}
+
+	png, ok := byQualifier["*.png"]
+	if !ok || png.BytesAbove != 3 || png.Total != 1 {
+		t.Errorf("expected %q to be added from delta, got %+v", "*.png", png)
+	}
+
+	// Mutating the merged result must not alter the original base entries,
+	// since a failed Save shouldn't leave the in-memory cache half-updated.
+	base[0].BytesAbove = 999
+	if psd.BytesAbove == 999 {
+		t.Errorf("mergeMigrateInfoEntries must clone base entries, not alias them")
+	}
+}
+
+func TestMigrateIndexEntryRoundTrip(t *testing.T) {
+	entries := []*MigrateInfoEntry{
+		{Qualifier: "*.psd", Matcher: "*.psd", BytesAbove: 1024, TotalAbove: 3, BytesTotal: 4096, Total: 12},
+		{Qualifier: "<other>", Matcher: "", BytesAbove: 0, TotalAbove: 0, BytesTotal: 0, Total: 0},
+		{Qualifier: "assets", Matcher: "assets", MatcherIsDir: true, BytesAbove: 512, TotalAbove: 1, BytesTotal: 512, Total: 1},
+	}
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	for _, entry := range entries {
+		migrateIndexWriteEntry(w, entry)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("unexpected error flushing entries: %v", err)
+	}
+
+	r := bufio.NewReader(&buf)
+	for i, want := range entries {
+		got, err := migrateIndexReadEntry(r)
+		if err != nil {
+			t.Fatalf("unexpected error reading entry %d: %v", i, err)
+		}
+		if *got != *want {
+			t.Errorf("entry %d round-tripped as %+v, want %+v", i, *got, *want)
+		}
+	}
+}
+
+func TestMigrateIndexSaveLoadRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate-index-test")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	idx := newMigrateIndex()
+	idx.RecordRange("key-1", "deadbeef", []*MigrateInfoEntry{
+		{Qualifier: "*.psd", Matcher: "*.psd", BytesAbove: 10, TotalAbove: 1, BytesTotal: 10, Total: 1},
+	}, map[string]bool{"oid-1": true, "oid-2": true})
+
+	path := filepath.Join(dir, "migrate-index")
+	if err := idx.saveTo(path); err != nil {
+		t.Fatalf("unexpected error saving index: %v", err)
+	}
+
+	loaded, err := loadMigrateIndexFrom(path)
+	if err != nil {
+		t.Fatalf("unexpected error loading index: %v", err)
+	}
+
+	state, ok := loaded.ranges["key-1"]
+	if !ok {
+		t.Fatalf("expected lineage %q to survive a save/load round trip", "key-1")
+	}
+	if state.Sha != "deadbeef" || len(state.Entries) != 1 {
+		t.Errorf("unexpected state for %q: %+v", "key-1", state)
+	}
+	if !state.Oids["oid-1"] || !state.Oids["oid-2"] || len(state.Oids) != 2 {
+		t.Errorf("expected both recorded OIDs to survive a save/load round trip, got %+v", state.Oids)
+	}
+}
+
+// TestMigrateIndexUnionOids covers the dedup primitive the incremental merge
+// relies on: a blob OID already present in the cached aggregate must end up
+// counted exactly once in the union handed back to RecordRange, regardless
+// of which side(s) it came from.
+func TestMigrateIndexUnionOids(t *testing.T) {
+	base := map[string]bool{"a": true, "b": true}
+	delta := map[string]bool{"b": true, "c": true}
+
+	union := migrateIndexUnionOids(base, delta)
+
+	want := map[string]bool{"a": true, "b": true, "c": true}
+	if len(union) != len(want) {
+		t.Fatalf("expected %d OIDs in the union, got %d: %+v", len(want), len(union), union)
+	}
+	for oid := range want {
+		if !union[oid] {
+			t.Errorf("expected %q in the union", oid)
+		}
+	}
+
+	// The union must be a new map: mutating it must not alter either input,
+	// since a failed Save shouldn't leave the in-memory cache half-updated.
+	union["d"] = true
+	if base["d"] || delta["d"] {
+		t.Errorf("migrateIndexUnionOids must not alias its inputs")
+	}
+}
+
+func TestMigrateIndexLineageKey(t *testing.T) {
+	a := migrateIndexLineageKey("ref:refs/heads/main")
+	b := migrateIndexLineageKey("ref:refs/heads/feature")
+	if a == b {
+		t.Errorf("expected different identities to produce different lineage keys")
+	}
+
+	if migrateIndexLineageKey("ref:refs/heads/main") != a {
+		t.Errorf("expected the same identity to produce a stable lineage key")
+	}
+}
+
+func TestMigrateIndexIsAncestor(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir, err := ioutil.TempDir("", "migrate-index-ancestor-test")
+	if err != nil {
+		t.Fatalf("unexpected error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	run := func(args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+		return string(out)
+	}
+
+	run("init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+	run("add", "a.txt")
+	run("commit", "-q", "-m", "first")
+	first := stringsTrimNewline(run("rev-parse", "HEAD"))
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatalf("unexpected error writing file: %v", err)
+	}
+	run("add", "b.txt")
+	run("commit", "-q", "-m", "second")
+	second := stringsTrimNewline(run("rev-parse", "HEAD"))
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("unexpected error getting working directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("unexpected error changing directory: %v", err)
+	}
+	defer os.Chdir(wd)
+
+	ok, err := migrateIndexIsAncestor(first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok {
+		t.Errorf("expected %q to be an ancestor of %q", first, second)
+	}
+
+	ok, err = migrateIndexIsAncestor(second, first)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ok {
+		t.Errorf("expected %q not to be an ancestor of %q", second, first)
+	}
+}
+
+func stringsTrimNewline(s string) string {
+	for len(s) > 0 && (s[len(s)-1] == '\n' || s[len(s)-1] == '\r') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
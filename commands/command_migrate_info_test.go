@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+)
+
+func TestMigrateInfoMatchSegments(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"exact match", "assets/foo.psd", "assets/foo.psd", true},
+		{"exact mismatch", "assets/foo.psd", "assets/bar.psd", false},
+		{"single star does not cross a slash", "assets/*.psd", "assets/sub/foo.psd", false},
+		{"single star within a segment", "assets/*.psd", "assets/foo.psd", true},
+		{"double star at zero depth", "assets/**/*.psd", "assets/foo.psd", true},
+		{"double star at one depth", "assets/**/*.psd", "assets/sub/foo.psd", true},
+		{"double star at many depths", "assets/**/*.psd", "assets/a/b/c/foo.psd", true},
+		{"double star requires the rest to still match", "assets/**/*.psd", "assets/a/b/c/foo.png", false},
+		{"leading double star", "**/*.psd", "a/b/foo.psd", true},
+		{"leading double star at zero depth", "**/*.psd", "foo.psd", true},
+		{"trailing double star matches everything below", "assets/**", "assets/a/b/foo.psd", true},
+		{"trailing double star requires the prefix", "assets/**", "other/a/b/foo.psd", false},
+		{"double star matches zero segments", "assets/**/foo.psd", "assets/foo.psd", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := migrateInfoMatchPattern(tt.pattern, tt.path)
+			if got != tt.match {
+				t.Errorf("migrateInfoMatchPattern(%q, %q) = %v, want %v",
+					tt.pattern, tt.path, got, tt.match)
+			}
+		})
+	}
+}
+
+// TestMigrateInfoPercentAbove covers the zero-total edge case, which exists
+// specifically so json.Marshal never has to encode NaN.
+func TestMigrateInfoPercentAbove(t *testing.T) {
+	tests := []struct {
+		name  string
+		above int64
+		total int64
+		want  float64
+	}{
+		{"zero total", 0, 0, 0},
+		{"half above threshold", 1, 2, 50},
+		{"all above threshold", 3, 3, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := migrateInfoPercentAbove(tt.above, tt.total)
+			if got != tt.want {
+				t.Errorf("migrateInfoPercentAbove(%d, %d) = %v, want %v", tt.above, tt.total, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestEntriesBySizeSummarize covers the totals computed across every entry,
+// which --format=json's top-level "summary" depends on being correct before
+// any --top clamp is applied.
+func TestEntriesBySizeSummarize(t *testing.T) {
+	entries := EntriesBySize{
+		{Qualifier: "*.psd", BytesAbove: 10, TotalAbove: 1, BytesTotal: 20, Total: 2},
+		{Qualifier: "*.zip", BytesAbove: 5, TotalAbove: 1, BytesTotal: 5, Total: 1},
+	}
+
+	migrateInfoAbove = 1024
+	summary := entries.summarize()
+
+	if summary.BytesAbove != 15 || summary.BytesTotal != 25 || summary.CountAbove != 2 || summary.CountTotal != 3 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	if summary.ThresholdBytes != migrateInfoAbove {
+		t.Errorf("expected summary.ThresholdBytes to be %d, got %d", migrateInfoAbove, summary.ThresholdBytes)
+	}
+}
+
+// TestEntriesBySizePrintJSON covers the shape of --format=json output: a
+// top-level "entries" array using the stable migrateInfoEntryColumns names,
+// plus the "summary" passed in verbatim.
+func TestEntriesBySizePrintJSON(t *testing.T) {
+	migrateInfoAbove = 100
+	entries := EntriesBySize{
+		{Qualifier: "*.psd", BytesAbove: 10, TotalAbove: 1, BytesTotal: 20, Total: 2},
+	}
+	summary := entries.summarize()
+
+	var buf bytes.Buffer
+	if _, err := entries.PrintJSON(&buf, summary); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var payload struct {
+		Entries []migrateInfoRow   `json:"entries"`
+		Summary migrateInfoSummary `json:"summary"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &payload); err != nil {
+		t.Fatalf("unexpected error unmarshaling JSON output: %v\n%s", err, buf.String())
+	}
+
+	if len(payload.Entries) != 1 || payload.Entries[0].Qualifier != "*.psd" {
+		t.Errorf("unexpected entries in JSON output: %+v", payload.Entries)
+	}
+	if payload.Entries[0].PercentAbove != 50 {
+		t.Errorf("expected percent_above of 50, got %v", payload.Entries[0].PercentAbove)
+	}
+	if payload.Summary != summary {
+		t.Errorf("expected summary %+v to be emitted verbatim, got %+v", summary, payload.Summary)
+	}
+}
+
+// TestEntriesBySizePrintCSV covers the CSV header and one data row, matching
+// migrateInfoEntryColumns column-for-column.
+func TestEntriesBySizePrintCSV(t *testing.T) {
+	migrateInfoAbove = 100
+	entries := EntriesBySize{
+		{Qualifier: "*.psd", BytesAbove: 10, TotalAbove: 1, BytesTotal: 20, Total: 2},
+	}
+
+	var buf bytes.Buffer
+	if _, err := entries.PrintCSV(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("unexpected error reading CSV output: %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected a header row and one data row, got %d rows: %+v", len(records), records)
+	}
+	if len(records[0]) != len(migrateInfoEntryColumns) {
+		t.Fatalf("expected header to have %d columns, got %d: %+v", len(migrateInfoEntryColumns), len(records[0]), records[0])
+	}
+	for i, name := range migrateInfoEntryColumns {
+		if records[0][i] != name {
+			t.Errorf("expected header column %d to be %q, got %q", i, name, records[0][i])
+		}
+	}
+	if records[1][0] != "*.psd" || records[1][1] != "10" || records[1][2] != "20" {
+		t.Errorf("unexpected data row: %+v", records[1])
+	}
+}
+
+// TestMigrateInfoAccumulateBlobSharedOidAcrossBuckets pins down the bug a
+// per-walk, per-OID dedup would reintroduce: two paths with identical
+// content (and therefore the same OID) belong to different buckets under
+// --group-by=dir, and each must be counted into its own bucket rather than
+// only the first one visited.
+func TestMigrateInfoAccumulateBlobSharedOidAcrossBuckets(t *testing.T) {
+	oldGroupBy, oldAbove := migrateInfoGroupBy, migrateInfoAbove
+	migrateInfoGroupBy = "dir"
+	migrateInfoAbove = 0
+	defer func() { migrateInfoGroupBy, migrateInfoAbove = oldGroupBy, oldAbove }()
+
+	exts := make(map[string]*MigrateInfoEntry)
+	migrateInfoAccumulateBlob(exts, nil, "a/file.bin", "deadbeef", 10)
+	migrateInfoAccumulateBlob(exts, nil, "b/file.bin", "deadbeef", 10)
+
+	if len(exts) != 2 {
+		t.Fatalf("expected a shared OID in two directories to produce two buckets, got %d: %+v", len(exts), exts)
+	}
+	if exts["a"] == nil || exts["a"].Total != 1 || exts["a"].BytesTotal != 10 {
+		t.Errorf("expected bucket %q to count its own occurrence of the shared OID, got %+v", "a", exts["a"])
+	}
+	if exts["b"] == nil || exts["b"].Total != 1 || exts["b"].BytesTotal != 10 {
+		t.Errorf("expected bucket %q to count its own occurrence of the shared OID, got %+v", "b", exts["b"])
+	}
+}
+
+// TestMigrateInfoAccumulateBlobHonorsSkip covers the actual, narrower
+// purpose of the "skip" set: a blob OID already counted by the cached
+// aggregate must not be counted again, regardless of which bucket it falls
+// into here.
+func TestMigrateInfoAccumulateBlobHonorsSkip(t *testing.T) {
+	oldGroupBy, oldAbove := migrateInfoGroupBy, migrateInfoAbove
+	migrateInfoGroupBy = "ext"
+	migrateInfoAbove = 0
+	defer func() { migrateInfoGroupBy, migrateInfoAbove = oldGroupBy, oldAbove }()
+
+	exts := make(map[string]*MigrateInfoEntry)
+	migrateInfoAccumulateBlob(exts, map[string]bool{"deadbeef": true}, "foo.psd", "deadbeef", 10)
+
+	if len(exts) != 0 {
+		t.Errorf("expected a skipped OID not to be counted at all, got %+v", exts)
+	}
+}